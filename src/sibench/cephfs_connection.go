@@ -0,0 +1,100 @@
+// SPDX-FileCopyrightText: 2022 SoftIron Limited <info@softiron.com>
+// SPDX-License-Identifier: GNU General Public License v2.0 only WITH Classpath exception 2.0
+
+package main
+
+import "fmt"
+import "logger"
+import "os"
+import "os/exec"
+
+/*
+ * A connection that benchmarks a CephFS mount.
+ *
+ * We mount the filesystem ourselves (via ceph-fuse, or the kernel client if requested) using
+ * the monitors and keyring supplied on the command line, and then delegate all the actual
+ * object I/O to FileConnectionBase, which just does regular file operations underneath our
+ * mount point.
+ */
+type CephFSConnection struct {
+	FileConnectionBase
+
+	monitors string
+	fsName   string
+	user     string
+	key      string
+	kernel   bool
+
+	mountPoint string
+}
+
+/* Create a new CephFSConnection, mounting the filesystem on a fresh temporary mount point. */
+func NewCephFSConnection(monitors string, fsName string, user string, key string, kernel bool, dir string) (*CephFSConnection, error) {
+	conn := &CephFSConnection{
+		monitors: monitors,
+		fsName:   fsName,
+		user:     user,
+		key:      key,
+		kernel:   kernel,
+	}
+
+	mountPoint, err := os.MkdirTemp("", "sibench-cephfs-")
+	if err != nil {
+		return nil, fmt.Errorf("Unable to create mount point for CephFS: %v", err)
+	}
+
+	conn.mountPoint = mountPoint
+	conn.InitFileConnectionBase(mountPoint, dir)
+
+	if err := conn.mount(); err != nil {
+		os.RemoveAll(mountPoint)
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+/* Mount the CephFS filesystem, either with ceph-fuse or the kernel client. */
+func (conn *CephFSConnection) mount() error {
+	var cmd *exec.Cmd
+
+	var redactedArgs []string
+
+	if conn.kernel {
+		source := conn.monitors + ":/"
+		args := []string{"-t", "ceph", source, conn.mountPoint,
+			"-o", fmt.Sprintf("mon_addr=%v,name=%v,secret=%v,fs=%v", conn.monitors, conn.user, conn.key, conn.fsName)}
+		cmd = exec.Command("mount", args...)
+		redactedArgs = []string{"-t", "ceph", source, conn.mountPoint,
+			"-o", fmt.Sprintf("mon_addr=%v,name=%v,secret=<redacted>,fs=%v", conn.monitors, conn.user, conn.fsName)}
+	} else {
+		args := []string{"--id", conn.user, "--key", conn.key, "-m", conn.monitors,
+			"--client_fs", conn.fsName, conn.mountPoint}
+		cmd = exec.Command("ceph-fuse", args...)
+		redactedArgs = []string{"--id", conn.user, "--key", "<redacted>", "-m", conn.monitors,
+			"--client_fs", conn.fsName, conn.mountPoint}
+	}
+
+	logger.Infof("Mounting CephFS at %v: %v\n", conn.mountPoint, redactedArgs)
+
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("Failed to mount CephFS: %v: %s", err, out)
+	}
+
+	return nil
+}
+
+/* Unmount the CephFS filesystem and clean up our mount point. */
+func (conn *CephFSConnection) Close() error {
+	cmd := exec.Command("umount", conn.mountPoint)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("Failed to unmount CephFS at %v: %v: %s", conn.mountPoint, err, out)
+	}
+
+	return os.RemoveAll(conn.mountPoint)
+}
+
+/* Target returns a human readable identifier for logging and reporting purposes. */
+func (conn *CephFSConnection) Target() string {
+	return fmt.Sprintf("cephfs:%v@%v", conn.fsName, conn.monitors)
+}
@@ -17,8 +17,9 @@ import "syscall"
  * remote filesystem is backed by the cluster under test), but it could be any dir really.
  *
  * FileConnectionBase is not intended to be used directly, but wrapped in a parent Connection
- * that knows how to create and tear-down the mount (such as CephFSConnection).   As such
- * it doesn't have the ususal connection constructor, or a Target() function.
+ * that knows how to create and tear-down the mount, such as CephFSConnection and
+ * NFSConnection.   As such it doesn't have the ususal connection constructor, or a
+ * Target() function.
  */
 type FileConnectionBase struct {
 	root string
@@ -0,0 +1,375 @@
+// SPDX-FileCopyrightText: 2022 SoftIron Limited <info@softiron.com>
+// SPDX-License-Identifier: GNU General Public License v2.0 only WITH Classpath exception 2.0
+
+package main
+
+import "bufio"
+import "fmt"
+import "math"
+import "math/rand"
+import "os"
+import "regexp"
+import "strconv"
+import "strings"
+
+/*
+ * A SizeGenerator produces the size (in bytes) of the next object a worker should write.
+ * Workers create one from Order.SizeDist, seeded from Order.Seed so that a given seed
+ * always reproduces the same sequence of sizes.
+ */
+type SizeGenerator interface {
+	NextSize(rng *rand.Rand) uint64
+}
+
+/*
+ * A KeyGenerator produces the index of the next object a worker should operate on, out of
+ * the working set described by [rangeStart, rangeEnd).  It lets us model hot-key and
+ * long-tail access patterns instead of always cycling uniformly through the working set.
+ */
+type KeyGenerator interface {
+	NextKey(rng *rand.Rand, rangeStart uint64, rangeEnd uint64) uint64
+}
+
+/* FixedSizeGenerator always returns the same size: the behaviour we had before this existed. */
+type FixedSizeGenerator struct {
+	size uint64
+}
+
+func (g *FixedSizeGenerator) NextSize(rng *rand.Rand) uint64 {
+	return g.size
+}
+
+/* LognormalSizeGenerator draws sizes from a lognormal distribution, for realistic object-size tails. */
+type LognormalSizeGenerator struct {
+	meanBytes float64
+	sigma     float64
+}
+
+func (g *LognormalSizeGenerator) NextSize(rng *rand.Rand) uint64 {
+	// The mean of a lognormal(mu, sigma) is exp(mu + sigma^2/2), so solve for mu.
+	mu := math.Log(g.meanBytes) - (g.sigma*g.sigma)/2
+	size := math.Exp(mu + g.sigma*rng.NormFloat64())
+
+	if size < 1 {
+		size = 1
+	}
+
+	return uint64(size)
+}
+
+/*
+ * ZipfSizeGenerator picks a size from a small ladder of power-of-two buckets above a
+ * baseline, skewed so that small sizes are drawn far more often than large ones - a
+ * reasonable approximation of the size distribution real object stores tend to see.
+ *
+ * imax for rand.NewZipf is inclusive (k ∈ [0, imax]), so buckets-1 gives the documented
+ * number of tiers: baseline<<0 .. baseline<<(buckets-1).
+ *
+ * The underlying rand.Zipf is bound to whichever *rand.Rand it was built with, so we defer
+ * building it until NextSize is first called with the rng the caller actually wants us to
+ * draw from, then cache it: this generator is only ever driven by the single owner (worker)
+ * that keeps calling NextSize with the same rng, exactly like zipfKeyGeneratorFactory.
+ */
+type ZipfSizeGenerator struct {
+	baseline uint64
+	buckets  uint64
+	s        float64
+	v        float64
+
+	zipf     *rand.Zipf
+	buildErr error
+}
+
+func NewZipfSizeGenerator(rng *rand.Rand, baseline uint64, s float64, v float64, buckets uint64) (*ZipfSizeGenerator, error) {
+	// Validate eagerly so a bad --size-dist spec fails at parse time rather than on the
+	// first draw; the rng used here is only for validation and is discarded.
+	if z := rand.NewZipf(rng, s, v, buckets-1); z == nil {
+		return nil, fmt.Errorf("Bad zipf parameters: s=%v v=%v", s, v)
+	}
+
+	return &ZipfSizeGenerator{baseline: baseline, buckets: buckets, s: s, v: v}, nil
+}
+
+func (g *ZipfSizeGenerator) NextSize(rng *rand.Rand) uint64 {
+	if g.zipf == nil && g.buildErr == nil {
+		g.zipf = rand.NewZipf(rng, g.s, g.v, g.buckets-1)
+		if g.zipf == nil {
+			g.buildErr = fmt.Errorf("Bad zipf parameters: s=%v v=%v", g.s, g.v)
+		}
+	}
+
+	if g.buildErr != nil {
+		// NewZipfSizeGenerator already validated these parameters, so this should be
+		// unreachable; treat it as the invariant violation it would be rather than
+		// silently returning the baseline size forever.
+		panic(fmt.Sprintf("zipf size generator: %v", g.buildErr))
+	}
+
+	return g.baseline << g.zipf.Uint64()
+}
+
+/* TraceSizeGenerator replays sizes sampled uniformly (with replacement) from a captured trace file. */
+type TraceSizeGenerator struct {
+	sizes []uint64
+}
+
+func NewTraceSizeGenerator(path string) (*TraceSizeGenerator, error) {
+	sizes, err := readTraceSizes(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sizes) == 0 {
+		return nil, fmt.Errorf("Trace file %v contained no usable sizes", path)
+	}
+
+	return &TraceSizeGenerator{sizes: sizes}, nil
+}
+
+func (g *TraceSizeGenerator) NextSize(rng *rand.Rand) uint64 {
+	return g.sizes[rng.Intn(len(g.sizes))]
+}
+
+/* readTraceSizes reads one object size per line (or the first CSV column) from a trace file. */
+func readTraceSizes(path string) ([]uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to open trace file %v: %v", path, err)
+	}
+	defer f.Close()
+
+	var sizes []uint64
+	scanner := bufio.NewScanner(f)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		field := strings.Split(line, ",")[0]
+		size, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Bad size %q in trace file %v: %v", field, path, err)
+		}
+
+		sizes = append(sizes, size)
+	}
+
+	return sizes, scanner.Err()
+}
+
+/* UniformKeyGenerator picks keys uniformly at random from the working set, with no skew. */
+type UniformKeyGenerator struct {
+}
+
+func (g *UniformKeyGenerator) NextKey(rng *rand.Rand, rangeStart uint64, rangeEnd uint64) uint64 {
+	return rangeStart + uint64(rng.Int63n(int64(rangeEnd-rangeStart)))
+}
+
+/* ZipfKeyGenerator skews access towards the start of the working set, to model hot keys. */
+type ZipfKeyGenerator struct {
+	zipf *rand.Zipf
+}
+
+func NewZipfKeyGenerator(rng *rand.Rand, s float64, v float64, rangeSize uint64) (*ZipfKeyGenerator, error) {
+	z := rand.NewZipf(rng, s, v, rangeSize-1)
+	if z == nil {
+		return nil, fmt.Errorf("Bad zipf parameters: s=%v v=%v", s, v)
+	}
+
+	return &ZipfKeyGenerator{zipf: z}, nil
+}
+
+func (g *ZipfKeyGenerator) NextKey(rng *rand.Rand, rangeStart uint64, rangeEnd uint64) uint64 {
+	return rangeStart + g.zipf.Uint64()
+}
+
+/*
+ * ParseSizeDistSpec parses a --size-dist argument such as "zipf:s=1.2,v=1",
+ * "lognormal:mean=64K,sigma=1.5" or "trace:file.csv" into a SizeGenerator.  A blank spec
+ * falls back to the fixed defaultSize, which preserves the historic behaviour.
+ */
+func ParseSizeDistSpec(spec string, defaultSize uint64, seed uint64) (SizeGenerator, error) {
+	if spec == "" {
+		return &FixedSizeGenerator{size: defaultSize}, nil
+	}
+
+	kind, params := splitDistSpec(spec)
+	rng := rand.New(rand.NewSource(int64(seed)))
+
+	switch kind {
+	case "fixed":
+		size, err := parseByteSize(params["size"])
+		if err != nil {
+			return nil, err
+		}
+		return &FixedSizeGenerator{size: size}, nil
+
+	case "lognormal":
+		mean, err := parseByteSize(params["mean"])
+		if err != nil {
+			return nil, err
+		}
+
+		sigma, err := parseFloatParam(params, "sigma", 1.0)
+		if err != nil {
+			return nil, err
+		}
+
+		return &LognormalSizeGenerator{meanBytes: float64(mean), sigma: sigma}, nil
+
+	case "zipf":
+		s, err := parseFloatParam(params, "s", 1.2)
+		if err != nil {
+			return nil, err
+		}
+
+		v, err := parseFloatParam(params, "v", 1.0)
+		if err != nil {
+			return nil, err
+		}
+
+		return NewZipfSizeGenerator(rng, defaultSize, s, v, 8)
+
+	case "trace":
+		if len(params) != 1 {
+			return nil, fmt.Errorf("Bad trace size-dist spec: %v", spec)
+		}
+		for _, path := range params {
+			return NewTraceSizeGenerator(path)
+		}
+	}
+
+	return nil, fmt.Errorf("Unknown size distribution: %v", spec)
+}
+
+/*
+ * ParseKeyDistSpec parses a --key-dist argument such as "zipf:s=1.2,v=1" into a
+ * KeyGenerator.  A blank spec gives the historic uniform access pattern.  rangeSize is the
+ * size of the working set (Order.RangeEnd - Order.RangeStart), which we already know at
+ * parse time, so we validate any zipf parameters against it up front rather than waiting to
+ * find out they were bad on the first key draw of the run.
+ */
+func ParseKeyDistSpec(spec string, rangeSize uint64) (KeyGenerator, error) {
+	if spec == "" {
+		return &UniformKeyGenerator{}, nil
+	}
+
+	kind, params := splitDistSpec(spec)
+
+	switch kind {
+	case "uniform":
+		return &UniformKeyGenerator{}, nil
+
+	case "zipf":
+		s, err := parseFloatParam(params, "s", 1.2)
+		if err != nil {
+			return nil, err
+		}
+
+		v, err := parseFloatParam(params, "v", 1.0)
+		if err != nil {
+			return nil, err
+		}
+
+		// Building here just validates s and v against the real range; the actual
+		// per-worker generator is built lazily by the factory below, since it needs
+		// a per-worker seed that isn't known until the worker starts.
+		if _, err := NewZipfKeyGenerator(rand.New(rand.NewSource(0)), s, v, rangeSize); err != nil {
+			return nil, err
+		}
+
+		return &zipfKeyGeneratorFactory{s: s, v: v}, nil
+	}
+
+	return nil, fmt.Errorf("Unknown key distribution: %v", spec)
+}
+
+/*
+ * zipfKeyGeneratorFactory defers building the underlying rand.Zipf until a worker gives it
+ * a seeded rng and the working set range, which aren't known when the CLI argument is
+ * parsed.  The generator is built once and cached, since a given factory is only ever
+ * driven with the one (rng, rangeStart, rangeEnd) a worker was created with.
+ */
+type zipfKeyGeneratorFactory struct {
+	s float64
+	v float64
+
+	gen      *ZipfKeyGenerator
+	buildErr error
+}
+
+func (f *zipfKeyGeneratorFactory) NextKey(rng *rand.Rand, rangeStart uint64, rangeEnd uint64) uint64 {
+	if f.gen == nil && f.buildErr == nil {
+		f.gen, f.buildErr = NewZipfKeyGenerator(rng, f.s, f.v, rangeEnd-rangeStart)
+	}
+
+	if f.buildErr != nil {
+		// ParseKeyDistSpec already validated these parameters against this same
+		// range, so this should be unreachable; treat it as the invariant
+		// violation it would be rather than silently falling back to rangeStart.
+		panic(fmt.Sprintf("zipf key generator: %v", f.buildErr))
+	}
+
+	return f.gen.NextKey(rng, rangeStart, rangeEnd)
+}
+
+var distSpecRegex = regexp.MustCompile(`^([a-zA-Z]+):(.*)$`)
+
+/* splitDistSpec splits "zipf:s=1.2,v=1" into ("zipf", {"s": "1.2", "v": "1"}). */
+func splitDistSpec(spec string) (string, map[string]string) {
+	groups := distSpecRegex.FindStringSubmatch(spec)
+	if groups == nil {
+		return spec, map[string]string{}
+	}
+
+	kind := groups[1]
+	params := make(map[string]string)
+
+	for _, term := range strings.Split(groups[2], ",") {
+		if term == "" {
+			continue
+		}
+
+		if idx := strings.Index(term, "="); idx >= 0 {
+			params[term[:idx]] = term[idx+1:]
+		} else {
+			params[fmt.Sprintf("%v", len(params))] = term
+		}
+	}
+
+	return kind, params
+}
+
+func parseFloatParam(params map[string]string, name string, def float64) (float64, error) {
+	val, ok := params[name]
+	if !ok {
+		return def, nil
+	}
+
+	f, err := strconv.ParseFloat(val, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Bad value for %v: %v", name, val)
+	}
+
+	return f, nil
+}
+
+/* parseByteSize parses a size such as "64K" or "1M" into a byte count. */
+func parseByteSize(spec string) (uint64, error) {
+	re := regexp.MustCompile(`^([1-9][0-9]*)([kKmM])$`)
+	groups := re.FindStringSubmatch(spec)
+	if groups == nil {
+		return 0, fmt.Errorf("Bad size specifier: %v", spec)
+	}
+
+	val, _ := strconv.ParseUint(groups[1], 10, 64)
+	size := val * 1024
+
+	if strings.EqualFold(groups[2], "m") {
+		size *= 1024
+	}
+
+	return size, nil
+}
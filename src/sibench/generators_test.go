@@ -0,0 +1,101 @@
+// SPDX-FileCopyrightText: 2022 SoftIron Limited <info@softiron.com>
+// SPDX-License-Identifier: GNU General Public License v2.0 only WITH Classpath exception 2.0
+
+package main
+
+import "math/rand"
+import "testing"
+
+func TestParseSizeDistSpecFixedDefault(t *testing.T) {
+	gen, err := ParseSizeDistSpec("", 4096, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if size := gen.NextSize(rand.New(rand.NewSource(0))); size != 4096 {
+		t.Errorf("expected default size 4096, got %v", size)
+	}
+}
+
+func TestParseSizeDistSpecBadZipfParams(t *testing.T) {
+	if _, err := ParseSizeDistSpec("zipf:s=1,v=1", 4096, 0); err == nil {
+		t.Errorf("expected error for s<=1, got nil")
+	}
+}
+
+func TestParseKeyDistSpecBadZipfParams(t *testing.T) {
+	if _, err := ParseKeyDistSpec("zipf:s=1,v=1", 1000); err == nil {
+		t.Errorf("expected error for s<=1, got nil")
+	}
+}
+
+func TestZipfSizeGeneratorBucketRange(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	gen, err := NewZipfSizeGenerator(rng, 1, 1.2, 1.0, 8)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	min, max := uint64(1)<<63, uint64(0)
+
+	for i := 0; i < 1000; i++ {
+		size := gen.NextSize(rng)
+		if size < min {
+			min = size
+		}
+		if size > max {
+			max = size
+		}
+	}
+
+	// buckets=8 should give tiers baseline<<0 .. baseline<<7, i.e. up to 128, never 256.
+	if max > 128 {
+		t.Errorf("expected max drawn size <= 128 (8 buckets), got %v", max)
+	}
+}
+
+func TestZipfSizeGeneratorUsesSuppliedRng(t *testing.T) {
+	gen, err := NewZipfSizeGenerator(rand.New(rand.NewSource(0)), 1, 1.2, 1.0, 8)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	a := gen.NextSize(rand.New(rand.NewSource(42)))
+
+	gen2, err := NewZipfSizeGenerator(rand.New(rand.NewSource(0)), 1, 1.2, 1.0, 8)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	b := gen2.NextSize(rand.New(rand.NewSource(42)))
+
+	if a != b {
+		t.Errorf("expected two generators drawing from identically-seeded rngs to agree, got %v and %v", a, b)
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	cases := []struct {
+		spec string
+		want uint64
+	}{
+		{"64k", 64 * 1024},
+		{"1M", 1024 * 1024},
+	}
+
+	for _, c := range cases {
+		got, err := parseByteSize(c.spec)
+		if err != nil {
+			t.Errorf("parseByteSize(%q): unexpected error: %v", c.spec, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("parseByteSize(%q) = %v, want %v", c.spec, got, c.want)
+		}
+	}
+
+	if _, err := parseByteSize("bogus"); err == nil {
+		t.Errorf("expected error for bogus size specifier, got nil")
+	}
+}
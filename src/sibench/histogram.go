@@ -0,0 +1,185 @@
+// SPDX-FileCopyrightText: 2022 SoftIron Limited <info@softiron.com>
+// SPDX-License-Identifier: GNU General Public License v2.0 only WITH Classpath exception 2.0
+
+package main
+
+import "fmt"
+import "io/ioutil"
+import "math"
+import "time"
+
+/*
+ * A Histogram is a fixed-bucket logarithmic latency histogram, in the style of HdrHistogram.
+ * It covers latencies from around 10us to around 60s with 3 significant digits of
+ * resolution, which is enough to report accurate percentiles without having to keep every
+ * individual sample around.
+ *
+ * Buckets are laid out linearly within each power-of-ten decade, giving low relative error
+ * (under 1%) regardless of whether the underlying latency is 100us or 10s.
+ */
+const (
+	histogramMinLatency = 10 * time.Microsecond
+	histogramMaxLatency = 60 * time.Second
+	histogramSigDigits  = 3
+	histogramBucketsPerDecade = 1000 // 10^histogramSigDigits
+)
+
+type Histogram struct {
+	counts   []uint64
+	total    uint64
+	overflow uint64
+	decades  int
+}
+
+/* NewHistogram creates an empty histogram covering our standard latency range. */
+func NewHistogram() *Histogram {
+	decades := int(math.Ceil(math.Log10(float64(histogramMaxLatency) / float64(histogramMinLatency))))
+
+	return &Histogram{
+		counts:  make([]uint64, decades*histogramBucketsPerDecade),
+		decades: decades,
+	}
+}
+
+/* bucketFor maps a latency to the index of the bucket that should record it. */
+func (h *Histogram) bucketFor(latency time.Duration) (int, bool) {
+	if latency < histogramMinLatency {
+		latency = histogramMinLatency
+	}
+
+	if latency >= histogramMaxLatency {
+		return 0, false
+	}
+
+	decade := int(math.Log10(float64(latency) / float64(histogramMinLatency)))
+	decadeStart := float64(histogramMinLatency) * math.Pow(10, float64(decade))
+	offset := int(float64(histogramBucketsPerDecade) * (float64(latency) - decadeStart) / (decadeStart * 9))
+
+	index := decade*histogramBucketsPerDecade + offset
+	if index < 0 || index >= len(h.counts) {
+		return 0, false
+	}
+
+	return index, true
+}
+
+/* latencyFor is the inverse of bucketFor: it returns the representative latency of a bucket. */
+func (h *Histogram) latencyFor(index int) time.Duration {
+	decade := index / histogramBucketsPerDecade
+	offset := index % histogramBucketsPerDecade
+
+	decadeStart := float64(histogramMinLatency) * math.Pow(10, float64(decade))
+	latency := decadeStart + (decadeStart*9)*float64(offset)/float64(histogramBucketsPerDecade)
+
+	return time.Duration(latency)
+}
+
+/* Record adds a single latency sample to the histogram. */
+func (h *Histogram) Record(latency time.Duration) {
+	h.total++
+
+	index, ok := h.bucketFor(latency)
+	if !ok {
+		h.overflow++
+		return
+	}
+
+	h.counts[index]++
+}
+
+/* Merge folds the samples from another histogram of the same shape into this one. */
+func (h *Histogram) Merge(other *Histogram) {
+	for i, c := range other.counts {
+		h.counts[i] += c
+	}
+
+	h.total += other.total
+	h.overflow += other.overflow
+}
+
+/* Percentile returns the latency below which the given fraction of samples fall. */
+func (h *Histogram) Percentile(p float64) time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+
+	target := uint64(math.Ceil(p * float64(h.total)))
+	var seen uint64
+
+	for i, c := range h.counts {
+		seen += c
+		if seen >= target {
+			return h.latencyFor(i)
+		}
+	}
+
+	return histogramMaxLatency
+}
+
+/* Counts returns the raw per-bucket counts, for callers that want to post-process externally. */
+func (h *Histogram) Counts() []uint64 {
+	return h.counts
+}
+
+/* Total is the number of samples recorded, including those that overflowed our range. */
+func (h *Histogram) Total() uint64 {
+	return h.total
+}
+
+/*
+ * A HistogramSummary is the subset of a Histogram we embed directly in the JSON report: the
+ * percentiles operators care about, without the raw bucket counts (which can be large and
+ * are only written out when --histogram-output is given).
+ */
+type HistogramSummary struct {
+	Count int64         `json:"count"`
+	P50   time.Duration `json:"p50_ns"`
+	P95   time.Duration `json:"p95_ns"`
+	P99   time.Duration `json:"p99_ns"`
+	P999  time.Duration `json:"p999_ns"`
+}
+
+/* Summarize extracts the percentiles we report in the JSON output. */
+func (h *Histogram) Summarize() HistogramSummary {
+	return HistogramSummary{
+		Count: int64(h.Total()),
+		P50:   h.Percentile(0.50),
+		P95:   h.Percentile(0.95),
+		P99:   h.Percentile(0.99),
+		P999:  h.Percentile(0.999),
+	}
+}
+
+/*
+ * A TimeSeriesPoint captures the state of a histogram accumulated over a single second of
+ * a phase, so that the report can show how latency and throughput evolved over time rather
+ * than just a single aggregate figure.
+ */
+type TimeSeriesPoint struct {
+	TimestampSec int64   `json:"timestamp_sec"`
+	Ops          uint64  `json:"ops"`
+	HistogramSummary
+}
+
+/*
+ * WriteHistogramBuckets writes the raw per-bucket counts for a set of named histograms to a
+ * file, one histogram per section, so that they can be post-processed by external tools.
+ */
+func WriteHistogramBuckets(path string, histograms map[string]*Histogram) error {
+	var contents string
+
+	for name, h := range histograms {
+		contents += fmt.Sprintf("# %v: min=%v max=%v sigdigits=%v buckets=%v\n",
+			name, histogramMinLatency, histogramMaxLatency, histogramSigDigits, len(h.counts))
+
+		for i, c := range h.counts {
+			if c == 0 {
+				continue
+			}
+
+			contents += fmt.Sprintf("%v,%v,%v\n", name, h.latencyFor(i), c)
+		}
+	}
+
+	return ioutil.WriteFile(path, []byte(contents), 0644)
+}
@@ -0,0 +1,109 @@
+// SPDX-FileCopyrightText: 2022 SoftIron Limited <info@softiron.com>
+// SPDX-License-Identifier: GNU General Public License v2.0 only WITH Classpath exception 2.0
+
+package main
+
+import "time"
+import "testing"
+
+func TestHistogramRecordAndTotal(t *testing.T) {
+	h := NewHistogram()
+
+	for i := 0; i < 10; i++ {
+		h.Record(time.Millisecond)
+	}
+
+	if h.Total() != 10 {
+		t.Errorf("expected Total() == 10, got %v", h.Total())
+	}
+}
+
+func TestHistogramOverflowNotDoubleCounted(t *testing.T) {
+	h := NewHistogram()
+
+	h.Record(time.Millisecond)        // in range
+	h.Record(histogramMaxLatency)     // out of range: overflow
+	h.Record(histogramMaxLatency * 2) // out of range: overflow
+
+	if h.Total() != 3 {
+		t.Errorf("expected Total() == 3 (one in range, two overflow), got %v", h.Total())
+	}
+
+	if h.overflow != 2 {
+		t.Errorf("expected 2 overflowed samples recorded, got %v", h.overflow)
+	}
+}
+
+func TestHistogramPercentile(t *testing.T) {
+	h := NewHistogram()
+
+	for i := 0; i < 100; i++ {
+		h.Record(time.Millisecond)
+	}
+
+	for i := 0; i < 100; i++ {
+		h.Record(100 * time.Millisecond)
+	}
+
+	p50 := h.Percentile(0.50)
+	if p50 < time.Millisecond || p50 > 2*time.Millisecond {
+		t.Errorf("expected p50 to fall near 1ms, got %v", p50)
+	}
+
+	p99 := h.Percentile(0.99)
+	if p99 < 90*time.Millisecond {
+		t.Errorf("expected p99 to fall near 100ms, got %v", p99)
+	}
+}
+
+func TestHistogramPercentileEmpty(t *testing.T) {
+	h := NewHistogram()
+
+	if p := h.Percentile(0.50); p != 0 {
+		t.Errorf("expected Percentile on an empty histogram to be 0, got %v", p)
+	}
+}
+
+func TestHistogramMerge(t *testing.T) {
+	a := NewHistogram()
+	b := NewHistogram()
+
+	a.Record(time.Millisecond)
+	b.Record(time.Millisecond)
+	b.Record(histogramMaxLatency)
+
+	a.Merge(b)
+
+	if a.Total() != 3 {
+		t.Errorf("expected merged Total() == 3, got %v", a.Total())
+	}
+}
+
+func TestBucketForRoundTrip(t *testing.T) {
+	h := NewHistogram()
+
+	latency := 5 * time.Millisecond
+	index, ok := h.bucketFor(latency)
+	if !ok {
+		t.Fatalf("expected bucketFor(%v) to succeed", latency)
+	}
+
+	got := h.latencyFor(index)
+	diff := got - latency
+	if diff < 0 {
+		diff = -diff
+	}
+
+	// Buckets give under 1% relative error, so the round trip should land close.
+	if float64(diff) > 0.01*float64(latency) {
+		t.Errorf("bucketFor/latencyFor round trip for %v landed at %v, too far off", latency, got)
+	}
+}
+
+func TestBucketForOutOfRange(t *testing.T) {
+	h := NewHistogram()
+
+	if _, ok := h.bucketFor(histogramMaxLatency); ok {
+		t.Errorf("expected bucketFor(histogramMaxLatency) to report out of range")
+	}
+}
@@ -18,11 +18,14 @@ type Arguments struct {
     Server bool
     S3 bool
     Rados bool
+    Cephfs bool
+    Nfs bool
     Run bool
     Verbose bool
 
     // Common options
     Port int
+    MetricsPort int
     Size string
     Objects int
     Servers string
@@ -30,7 +33,13 @@ type Arguments struct {
     RampUp int
     RampDown int
     JsonOutput string
+    HistogramOutput string
     Targets []string
+    Mix string
+    ThinkTime string
+    SizeDist string
+    KeyDist string
+    TargetRate string
 
     // S3 options
     S3AccessKey string
@@ -43,9 +52,23 @@ type Arguments struct {
     CephUser string
     CephKey  string
 
+    // CephFS options
+    CephMonitors string
+    CephFsName string
+    CephFsDir string
+    CephFsKernel bool
+
+    // NFS options
+    NfsServer string
+    NfsExport string
+    NfsDir string
+
     // Synthesized options
     Bucket string
     SizeInBytes uint64
+    Workload *WorkloadSpec
+    ThinkTimeDuration time.Duration
+    TargetRateOps float64
 }
 
 
@@ -53,20 +76,30 @@ type Arguments struct {
 func usage() string {
     return `SoftIron Benchmark Tool.
 Usage:
-  sibench server    [-v] [-p PORT]
-  sibench s3 run    [-v] [-p PORT] [-s SIZE] [-o COUNT] [-r TIME] [-u TIME] [-d TIME] [-j FILE] [--servers SERVERS] <targets> ...
+  sibench server    [-v] [-p PORT] [--metrics-port PORT]
+  sibench s3 run    [-v] [-p PORT] [-s SIZE] [-o COUNT] [-r TIME] [-u TIME] [-d TIME] [-j FILE] [--histogram-output FILE] [--servers SERVERS] <targets> ...
                     [--s3-port PORT] [--s3-bucket BUCKET] (--s3-access-key KEY) (--s3-secret-key KEY)
-  sibench rados run [-v] [-p PORT] [-s SIZE] [-o COUNT] [-r TIME] [-u TIME] [-d TIME] [-j FILE] [--servers SERVERS] <targets> ...
+                    [--mix MIX] [--think-time MS] [--size-dist DIST] [--key-dist DIST] [--target-rate RATE]
+  sibench rados run [-v] [-p PORT] [-s SIZE] [-o COUNT] [-r TIME] [-u TIME] [-d TIME] [-j FILE] [--histogram-output FILE] [--servers SERVERS] <targets> ...
                     [--ceph-pool POOL] [--ceph-user USER] (--ceph-key KEY)
+                    [--mix MIX] [--think-time MS] [--size-dist DIST] [--key-dist DIST] [--target-rate RATE]
+  sibench cephfs run [-v] [-p PORT] [-s SIZE] [-o COUNT] [-r TIME] [-u TIME] [-d TIME] [-j FILE] [--histogram-output FILE] [--servers SERVERS] <targets> ...
+                    (--ceph-monitors MONS) (--ceph-user USER) (--ceph-key KEY) [--ceph-fs-name NAME] [--ceph-fs-dir DIR] [--ceph-fs-kernel]
+                    [--mix MIX] [--think-time MS] [--size-dist DIST] [--key-dist DIST] [--target-rate RATE]
+  sibench nfs run   [-v] [-p PORT] [-s SIZE] [-o COUNT] [-r TIME] [-u TIME] [-d TIME] [-j FILE] [--histogram-output FILE] [--servers SERVERS] <targets> ...
+                    (--nfs-server SERVER) (--nfs-export EXPORT) [--nfs-dir DIR]
+                    [--mix MIX] [--think-time MS] [--size-dist DIST] [--key-dist DIST] [--target-rate RATE]
 Options:
   -v, --verbose                Turn on debug output
   -p PORT, --port PORT         The port on which sibench communicates.  [default: 5150]
+  --metrics-port PORT           The port on which the server exposes Prometheus metrics.  [default: 5151]
   -s SIZE, --size SIZE         Object size to test, in units of K or M.   [default: 1M]
   -o COUNT, --objects COUNT    The number of objects to use as our working set.  [default: 1000]
   -r TIME, --run-time TIME     The time spent on each phase of the benchmark.  [default: 30]
   -u TIME, --ramp-up TIME      The extra time we run at the start of each phase where we don't collect stats.  [default: 5]
   -d TIME, --ramp-down TIME    The extra time we run at the end of each phase where we don't collect stats.  [default: 2]
   -j FILE, --json-output FILE  The file to which we write our json results.
+  --histogram-output FILE      The file to which we write raw latency histogram bucket counts, for post-processing.
   --servers SERVERS            A comma-separated list of sibench servers to connect to.  [default: localhost]
   --s3-port PORT               The port on which to connect to S3.  [default: 7480]
   --s3-bucket BUCKET           The name of the bucket we wish to use for S3 operations.  [default: sibench]
@@ -75,6 +108,18 @@ Options:
   --ceph-pool POOL             The pool we use for benchmarking.  [default: sibench]
   --ceph-user USER             The ceph username we use.  [default: admin]
   --ceph-key KEY               The secret key belonging to the ceph user
+  --mix MIX                    Run a mixed workload with the given ratio of GET/PUT/DELETE, eg "70r/20w/10d".
+  --think-time MS              Mean think time (in ms) between operations when running a mixed workload, drawn from a Poisson process.  [default: 0]
+  --ceph-monitors MONS          A comma-separated list of ceph monitor addresses to mount CephFS with.
+  --ceph-fs-name NAME           The name of the CephFS filesystem to mount.  [default: cephfs]
+  --ceph-fs-dir DIR             The subdirectory of the CephFS mount under which we benchmark.  [default: sibench]
+  --ceph-fs-kernel              Mount CephFS with the kernel client instead of ceph-fuse.
+  --nfs-server SERVER           The hostname or address of the NFS server to mount.
+  --nfs-export EXPORT           The path of the NFS export to mount.
+  --nfs-dir DIR                 The subdirectory of the NFS mount under which we benchmark.  [default: sibench]
+  --size-dist DIST              Object size distribution: "zipf:s=1.2,v=1", "lognormal:mean=64K,sigma=1.5" or "trace:FILE".  Defaults to the fixed --size.
+  --key-dist DIST                Key access distribution: "uniform" or "zipf:s=1.2,v=1".  Defaults to uniform.
+  --target-rate RATE              Run open-loop at a fixed rate (ops/sec) instead of closed-loop, recording service and response latency separately.
 `
 }
 
@@ -116,6 +161,10 @@ func validateArguments(args *Arguments) error {
         return fmt.Errorf("S3 Port not in range: %v", args.S3Port)
     }
 
+    if (args.MetricsPort < 0) || ( args.MetricsPort > int(math.MaxUint16)) {
+        return fmt.Errorf("Metrics port not in range: %v", args.MetricsPort)
+    }
+
     // Turn the size (in K or M) into bytes...
 
     re := regexp.MustCompile(`([1-9][0-9]*)([kKmM])`)
@@ -130,6 +179,57 @@ func validateArguments(args *Arguments) error {
         args.SizeInBytes *= 1024
     }
 
+    // If we've been given a mix specifier, then we're running a mixed read/write workload
+    // rather than the usual fixed sequence of phases.
+
+    if args.Mix != "" {
+        ws, err := ParseWorkloadSpec(args.Mix)
+        if err != nil {
+            return err
+        }
+
+        thinkTime, err := ParseThinkTime(args.ThinkTime)
+        if err != nil {
+            return err
+        }
+
+        ws.ThinkTime = thinkTime
+        if err := ws.validate(); err != nil {
+            return err
+        }
+
+        args.Workload = ws
+        args.ThinkTimeDuration = thinkTime
+    }
+
+    // Make sure our distribution specs are well-formed, even though the generators
+    // themselves aren't built until each worker starts (they need a per-worker seed).
+
+    if _, err := ParseSizeDistSpec(args.SizeDist, args.SizeInBytes, 0); err != nil {
+        return err
+    }
+
+    if _, err := ParseKeyDistSpec(args.KeyDist, uint64(args.Objects)); err != nil {
+        return err
+    }
+
+    // If we've been given a target rate, then we run open-loop: each worker schedules
+    // operations at a fixed rate rather than issuing the next one as soon as the last
+    // completes, so that we don't under-report tail latency when the target saturates.
+
+    if args.TargetRate != "" {
+        rate, err := strconv.ParseFloat(args.TargetRate, 64)
+        if err != nil {
+            return fmt.Errorf("Bad target rate: %v", args.TargetRate)
+        }
+
+        if rate <= 0 {
+            return fmt.Errorf("Target rate must be positive: %v", args.TargetRate)
+        }
+
+        args.TargetRateOps = rate
+    }
+
     return nil
 }
 
@@ -164,7 +264,12 @@ func main() {
 
 /* Start a server, listening on a TCP port */
 func startServer(args *Arguments) {
-    err := StartForeman(uint16(args.Port))
+    metrics := NewMetrics()
+
+    err := StartMetricsServer(uint16(args.MetricsPort), metrics)
+    dieOnError(err, "Failure creating metrics server")
+
+    err = StartForeman(uint16(args.Port), metrics)
     dieOnError(err, "Failure creating server")
 }
 
@@ -186,13 +291,35 @@ func startRun(args *Arguments) {
     j.order.RangeStart = 0
     j.order.RangeEnd = uint64(args.Objects)
     j.order.Targets = args.Targets
+    j.order.Workload = args.Workload
+    j.order.SizeDistSpec = args.SizeDist
+    j.order.KeyDistSpec = args.KeyDist
+    j.order.TargetRate = args.TargetRateOps
 
-    if args.S3 {
+    switch {
+    case args.S3:
         j.order.ConnectionType = "s3"
         j.order.Bucket = args.S3Bucket
         j.order.Credentials = map[string]string { "access_key": args.S3AccessKey, "secret_key": args.S3SecretKey }
         j.order.Port = uint16(args.S3Port)
-    } else {
+
+    case args.Cephfs:
+        j.order.ConnectionType = "cephfs"
+        j.order.Bucket = args.CephFsDir
+        j.order.Credentials = map[string]string {
+            "monitors": args.CephMonitors,
+            "user": args.CephUser,
+            "key": args.CephKey,
+            "fs_name": args.CephFsName,
+            "kernel": strconv.FormatBool(args.CephFsKernel),
+        }
+
+    case args.Nfs:
+        j.order.ConnectionType = "nfs"
+        j.order.Bucket = args.NfsDir
+        j.order.Credentials = map[string]string { "server": args.NfsServer, "export": args.NfsExport }
+
+    default:
         j.order.ConnectionType = "rados"
         j.order.Bucket = args.CephPool
         j.order.Credentials = map[string]string { "username": args.CephUser, "key": args.CephKey }
@@ -214,6 +341,11 @@ func startRun(args *Arguments) {
         dieOnError(err, "Unable to write json report to file: %v", args.JsonOutput)
     }
 
+    if args.HistogramOutput != "" {
+        err = WriteHistogramBuckets(args.HistogramOutput, j.report.Histograms)
+        dieOnError(err, "Unable to write histogram report to file: %v", args.HistogramOutput)
+    }
+
     fmt.Printf("Done\n")
 }
 
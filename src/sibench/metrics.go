@@ -0,0 +1,147 @@
+// SPDX-FileCopyrightText: 2022 SoftIron Limited <info@softiron.com>
+// SPDX-License-Identifier: GNU General Public License v2.0 only WITH Classpath exception 2.0
+
+package main
+
+import "fmt"
+import "logger"
+import "net"
+import "net/http"
+import "sync"
+import "sync/atomic"
+import "time"
+
+/*
+ * Metrics holds the live counters and gauges for a running Foreman, so that they can be
+ * scraped over HTTP by Prometheus while a benchmark is in progress, rather than only being
+ * available once the run has finished and the JSON report has been written.
+ *
+ * All the fields here are updated by workers as they run, and read by the /metrics HTTP
+ * handler, so access is protected either by being atomic or by opsMutex as appropriate.
+ */
+type Metrics struct {
+	inFlight int64
+
+	opsMutex   sync.Mutex
+	opCounts   map[string]map[OpType]uint64 // target -> op -> count
+	byteCounts map[string]uint64            // target -> bytes transferred
+	histograms map[OpType]*Histogram
+
+	phase atomic.Value // string
+}
+
+/* NewMetrics creates an empty Metrics ready to be published by StartMetricsServer. */
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		opCounts:   make(map[string]map[OpType]uint64),
+		byteCounts: make(map[string]uint64),
+		histograms: map[OpType]*Histogram{
+			OpPut:    NewHistogram(),
+			OpGet:    NewHistogram(),
+			OpDelete: NewHistogram(),
+		},
+	}
+
+	m.phase.Store("idle")
+	return m
+}
+
+/* SetPhase records the phase (eg "write", "read", "cleanup") the Foreman is currently running. */
+func (m *Metrics) SetPhase(phase string) {
+	m.phase.Store(phase)
+}
+
+/* BeginOp marks the start of an in-flight operation. */
+func (m *Metrics) BeginOp() {
+	atomic.AddInt64(&m.inFlight, 1)
+}
+
+/* EndOp records the completion of an operation: its target, type, size and latency. */
+func (m *Metrics) EndOp(target string, op OpType, bytes uint64, latency time.Duration) {
+	atomic.AddInt64(&m.inFlight, -1)
+
+	m.opsMutex.Lock()
+	defer m.opsMutex.Unlock()
+
+	if m.opCounts[target] == nil {
+		m.opCounts[target] = make(map[OpType]uint64)
+	}
+
+	m.opCounts[target][op]++
+	m.byteCounts[target] += bytes
+	m.histograms[op].Record(latency)
+}
+
+/* render produces the metrics in Prometheus's simple text exposition format. */
+func (m *Metrics) render() string {
+	m.opsMutex.Lock()
+	defer m.opsMutex.Unlock()
+
+	out := ""
+
+	out += "# HELP sibench_in_flight_requests Number of requests currently in flight.\n"
+	out += "# TYPE sibench_in_flight_requests gauge\n"
+	out += fmt.Sprintf("sibench_in_flight_requests %v\n", atomic.LoadInt64(&m.inFlight))
+
+	out += "# HELP sibench_phase_info The phase the benchmark is currently running.\n"
+	out += "# TYPE sibench_phase_info gauge\n"
+	out += fmt.Sprintf("sibench_phase_info{phase=\"%v\"} 1\n", m.phase.Load().(string))
+
+	out += "# HELP sibench_ops_total Total number of operations issued, by target and type.\n"
+	out += "# TYPE sibench_ops_total counter\n"
+	for target, counts := range m.opCounts {
+		for op, count := range counts {
+			out += fmt.Sprintf("sibench_ops_total{target=\"%v\",op=\"%v\"} %v\n", target, op, count)
+		}
+	}
+
+	out += "# HELP sibench_bytes_total Total number of bytes transferred, by target.\n"
+	out += "# TYPE sibench_bytes_total counter\n"
+	for target, bytes := range m.byteCounts {
+		out += fmt.Sprintf("sibench_bytes_total{target=\"%v\"} %v\n", target, bytes)
+	}
+
+	out += "# HELP sibench_latency_seconds Operation latency percentiles, by type.\n"
+	out += "# TYPE sibench_latency_seconds summary\n"
+	for op, h := range m.histograms {
+		s := h.Summarize()
+		out += fmt.Sprintf("sibench_latency_seconds{op=\"%v\",quantile=\"0.5\"} %v\n", op, s.P50.Seconds())
+		out += fmt.Sprintf("sibench_latency_seconds{op=\"%v\",quantile=\"0.95\"} %v\n", op, s.P95.Seconds())
+		out += fmt.Sprintf("sibench_latency_seconds{op=\"%v\",quantile=\"0.99\"} %v\n", op, s.P99.Seconds())
+		out += fmt.Sprintf("sibench_latency_seconds_count{op=\"%v\"} %v\n", op, s.Count)
+	}
+
+	return out
+}
+
+/*
+ * StartMetricsServer starts an HTTP server exposing a /metrics endpoint in Prometheus's
+ * text exposition format, so that a running Foreman can be scraped by existing monitoring
+ * infrastructure rather than only reporting results once the whole job is done.
+ */
+func StartMetricsServer(port uint16, metrics *Metrics) error {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		fmt.Fprint(w, metrics.render())
+	})
+
+	addr := fmt.Sprintf(":%v", port)
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("Unable to bind metrics server to %v: %v", addr, err)
+	}
+
+	logger.Infof("Serving Prometheus metrics on %v/metrics\n", addr)
+
+	go func() {
+		err := http.Serve(listener, mux)
+		if err != nil {
+			logger.Errorf("Metrics server on %v failed: %v\n", addr, err)
+		}
+	}()
+
+	return nil
+}
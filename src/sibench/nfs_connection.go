@@ -0,0 +1,75 @@
+// SPDX-FileCopyrightText: 2022 SoftIron Limited <info@softiron.com>
+// SPDX-License-Identifier: GNU General Public License v2.0 only WITH Classpath exception 2.0
+
+package main
+
+import "fmt"
+import "logger"
+import "os"
+import "os/exec"
+
+/*
+ * A connection that benchmarks an NFS export, such as one served up by a Ceph RGW NFS
+ * gateway.  As with CephFSConnection, we just mount the export ourselves and delegate the
+ * actual object I/O to FileConnectionBase.
+ */
+type NFSConnection struct {
+	FileConnectionBase
+
+	server string
+	export string
+
+	mountPoint string
+}
+
+/* Create a new NFSConnection, mounting the export on a fresh temporary mount point. */
+func NewNFSConnection(server string, export string, dir string) (*NFSConnection, error) {
+	conn := &NFSConnection{
+		server: server,
+		export: export,
+	}
+
+	mountPoint, err := os.MkdirTemp("", "sibench-nfs-")
+	if err != nil {
+		return nil, fmt.Errorf("Unable to create mount point for NFS: %v", err)
+	}
+
+	conn.mountPoint = mountPoint
+	conn.InitFileConnectionBase(mountPoint, dir)
+
+	if err := conn.mount(); err != nil {
+		os.RemoveAll(mountPoint)
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+/* Mount the NFS export. */
+func (conn *NFSConnection) mount() error {
+	source := fmt.Sprintf("%v:%v", conn.server, conn.export)
+	cmd := exec.Command("mount", "-t", "nfs", source, conn.mountPoint)
+
+	logger.Infof("Mounting NFS export at %v: %v\n", conn.mountPoint, cmd.Args)
+
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("Failed to mount NFS export: %v: %s", err, out)
+	}
+
+	return nil
+}
+
+/* Unmount the NFS export and clean up our mount point. */
+func (conn *NFSConnection) Close() error {
+	cmd := exec.Command("umount", conn.mountPoint)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("Failed to unmount NFS export at %v: %v: %s", conn.mountPoint, err, out)
+	}
+
+	return os.RemoveAll(conn.mountPoint)
+}
+
+/* Target returns a human readable identifier for logging and reporting purposes. */
+func (conn *NFSConnection) Target() string {
+	return fmt.Sprintf("nfs:%v:%v", conn.server, conn.export)
+}
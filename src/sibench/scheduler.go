@@ -0,0 +1,84 @@
+// SPDX-FileCopyrightText: 2022 SoftIron Limited <info@softiron.com>
+// SPDX-License-Identifier: GNU General Public License v2.0 only WITH Classpath exception 2.0
+
+package main
+
+import "fmt"
+import "time"
+
+/*
+ * A RateScheduler hands out the intended start time of each operation a worker should
+ * issue, advancing by a fixed interval each time regardless of how long the previous
+ * operation actually took.  This gives us open-loop load generation: if the target system
+ * is slow to respond, we don't slow down and issue fewer requests (as a closed-loop
+ * issue-wait-issue worker would), which is what causes coordinated omission and hides tail
+ * latency under saturation.
+ */
+type RateScheduler struct {
+	interval time.Duration
+	next     time.Time
+}
+
+/* NewRateScheduler creates a scheduler that hands out intended start times 1/targetRate seconds apart. */
+func NewRateScheduler(targetRate float64) (*RateScheduler, error) {
+	if targetRate <= 0 {
+		return nil, fmt.Errorf("Target rate must be positive: %v", targetRate)
+	}
+
+	return &RateScheduler{
+		interval: time.Duration(float64(time.Second) / targetRate),
+		next:     time.Now(),
+	}, nil
+}
+
+/*
+ * NextIntendedStart returns the time at which the next operation should have started, and
+ * advances our internal clock by one interval so that the schedule doesn't drift even if
+ * the caller is late calling us.
+ */
+func (s *RateScheduler) NextIntendedStart() time.Time {
+	intended := s.next
+	s.next = s.next.Add(s.interval)
+	return intended
+}
+
+/*
+ * WaitUntil blocks until the given intended start time, if it is still in the future.  If
+ * we're already running behind (the target system is saturated), it returns immediately.
+ * Since the schedule doesn't drift, a worker that has fallen behind gets intended start
+ * times that are already past, and so issues its overdue requests back to back until it
+ * has caught up.
+ */
+func WaitUntil(intended time.Time) {
+	delay := time.Until(intended)
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+/*
+ * OpLatencies holds the two latency measurements we take for a single open-loop operation.
+ *
+ * ServiceLatency is how long the operation itself took, once it actually started - the
+ * figure a closed-loop benchmark would have reported.
+ *
+ * ResponseLatency is measured from the intended start time, so it also captures any
+ * queueing delay caused by the worker being busy (typically because the SUT was slow to
+ * respond to a previous request).  This is the figure that avoids coordinated omission.
+ */
+type OpLatencies struct {
+	ServiceLatency  time.Duration
+	ResponseLatency time.Duration
+}
+
+/* MeasureOp runs op, timing it both from its intended start and from when it actually began. */
+func MeasureOp(intended time.Time, op func() error) (OpLatencies, error) {
+	actualStart := time.Now()
+	err := op()
+	completed := time.Now()
+
+	return OpLatencies{
+		ServiceLatency:  completed.Sub(actualStart),
+		ResponseLatency: completed.Sub(intended),
+	}, err
+}
@@ -0,0 +1,201 @@
+// SPDX-FileCopyrightText: 2022 SoftIron Limited <info@softiron.com>
+// SPDX-License-Identifier: GNU General Public License v2.0 only WITH Classpath exception 2.0
+
+package main
+
+import "fmt"
+import "math"
+import "math/rand"
+import "regexp"
+import "strconv"
+import "time"
+
+/*
+ * An OpType identifies which kind of operation a worker should perform next when it is
+ * running a mixed read/write workload, as opposed to the traditional fixed-phase benchmark.
+ */
+type OpType int
+
+const (
+	OpPut OpType = iota
+	OpGet
+	OpDelete
+)
+
+func (op OpType) String() string {
+	switch op {
+	case OpPut:
+		return "put"
+	case OpGet:
+		return "get"
+	case OpDelete:
+		return "delete"
+	default:
+		return "unknown"
+	}
+}
+
+/*
+ * A WorkloadSpec describes a mixed workload: the relative proportions of PUT, GET and
+ * DELETE operations that a worker should issue, and the mean think time to wait between
+ * issuing one operation and the next.
+ *
+ * It is carried on the Job's order (see Order.Workload) so that it can be shipped out to
+ * each Foreman and used by the workers they spawn, in place of the usual fixed sequence of
+ * write/read/delete phases.
+ */
+type WorkloadSpec struct {
+	PutRatio    uint64
+	GetRatio    uint64
+	DeleteRatio uint64
+
+	// Mean of the Poisson process used to generate inter-request think time.  Zero means
+	// no think time: the worker issues the next operation as soon as the previous one completes.
+	ThinkTime time.Duration
+}
+
+/*
+ * We expect a mix specifier of the form "70r/20w/10d", where the three numbers are the
+ * relative weights of GET, PUT and DELETE respectively, in any order, and are not required
+ * to sum to 100.
+ */
+var mixTermRegex = regexp.MustCompile(`^([0-9]+)([rwd])$`)
+
+/* Parse a mix specifier such as "70r/20w/10d" into a WorkloadSpec. */
+func ParseWorkloadSpec(spec string) (*WorkloadSpec, error) {
+	var ws WorkloadSpec
+
+	terms := splitNonEmpty(spec, "/")
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("Empty mix specifier")
+	}
+
+	seen := make(map[string]bool)
+
+	for _, term := range terms {
+		groups := mixTermRegex.FindStringSubmatch(term)
+		if groups == nil {
+			return nil, fmt.Errorf("Bad mix term: %v (expected e.g. 70r)", term)
+		}
+
+		if seen[groups[2]] {
+			return nil, fmt.Errorf("Duplicate mix term for %v", groups[2])
+		}
+		seen[groups[2]] = true
+
+		weight, err := strconv.ParseUint(groups[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Bad mix weight %v: %v", groups[1], err)
+		}
+
+		switch groups[2] {
+		case "r":
+			ws.GetRatio = weight
+		case "w":
+			ws.PutRatio = weight
+		case "d":
+			ws.DeleteRatio = weight
+		}
+	}
+
+	if ws.PutRatio+ws.GetRatio+ws.DeleteRatio == 0 {
+		return nil, fmt.Errorf("Mix specifier %v has no weight", spec)
+	}
+
+	return &ws, nil
+}
+
+/* Parse a think-time specifier, given in milliseconds, into a duration. */
+func ParseThinkTime(spec string) (time.Duration, error) {
+	if spec == "" {
+		return 0, nil
+	}
+
+	ms, err := strconv.ParseFloat(spec, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Bad think-time specifier: %v", spec)
+	}
+
+	if ms < 0 {
+		return 0, fmt.Errorf("Think-time may not be negative: %v", spec)
+	}
+
+	return time.Duration(ms * float64(time.Millisecond)), nil
+}
+
+func splitNonEmpty(s string, sep string) []string {
+	var result []string
+	start := 0
+
+	for i := 0; i <= len(s); i++ {
+		if i == len(s) || string(s[i]) == sep {
+			if i > start {
+				result = append(result, s[start:i])
+			}
+			start = i + 1
+		}
+	}
+
+	return result
+}
+
+/*
+ * NextOp picks the next operation to perform, weighted according to our ratios.  It is
+ * intended to be called by a worker once per iteration of its mixed-workload loop, using
+ * a per-worker RNG seeded from Order.Seed so that runs are reproducible.
+ */
+func (ws *WorkloadSpec) NextOp(rng *rand.Rand) OpType {
+	total := ws.PutRatio + ws.GetRatio + ws.DeleteRatio
+	roll := uint64(rng.Int63n(int64(total)))
+
+	if roll < ws.PutRatio {
+		return OpPut
+	}
+
+	if roll < ws.PutRatio+ws.GetRatio {
+		return OpGet
+	}
+
+	return OpDelete
+}
+
+/*
+ * NextThinkTime draws a think time from an exponential distribution with the configured
+ * mean, which makes the resulting inter-request arrivals a Poisson process.
+ */
+func (ws *WorkloadSpec) NextThinkTime(rng *rand.Rand) time.Duration {
+	if ws.ThinkTime == 0 {
+		return 0
+	}
+
+	return time.Duration(rng.ExpFloat64() * float64(ws.ThinkTime))
+}
+
+/*
+ * Sanity check that our ratios are usable: non-negative, summing to something positive, and
+ * small enough that NextOp's uint64(rng.Int63n(int64(total))) can't turn a wrapped-negative
+ * int64 into a panic.
+ */
+func (ws *WorkloadSpec) validate() error {
+	if ws.PutRatio+ws.GetRatio+ws.DeleteRatio == 0 {
+		return fmt.Errorf("Workload mix must have at least one non-zero ratio")
+	}
+
+	if ws.PutRatio > math.MaxUint64-ws.GetRatio || ws.PutRatio+ws.GetRatio > math.MaxUint64-ws.DeleteRatio {
+		return fmt.Errorf("Workload mix ratios overflow")
+	}
+
+	if total := ws.PutRatio + ws.GetRatio + ws.DeleteRatio; total > math.MaxInt64 {
+		return fmt.Errorf("Workload mix ratios must sum to no more than %v, got %v", uint64(math.MaxInt64), total)
+	}
+
+	if ws.ThinkTime < 0 {
+		return fmt.Errorf("Think time may not be negative")
+	}
+
+	if ws.ThinkTime > 0 && math.IsInf(float64(ws.ThinkTime), 0) {
+		return fmt.Errorf("Think time is not finite")
+	}
+
+	return nil
+}
@@ -0,0 +1,76 @@
+// SPDX-FileCopyrightText: 2022 SoftIron Limited <info@softiron.com>
+// SPDX-License-Identifier: GNU General Public License v2.0 only WITH Classpath exception 2.0
+
+package main
+
+import "math"
+import "math/rand"
+import "testing"
+
+func TestParseWorkloadSpec(t *testing.T) {
+	ws, err := ParseWorkloadSpec("70r/20w/10d")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if ws.GetRatio != 70 || ws.PutRatio != 20 || ws.DeleteRatio != 10 {
+		t.Errorf("got %+v, want GetRatio=70 PutRatio=20 DeleteRatio=10", ws)
+	}
+}
+
+func TestParseWorkloadSpecErrors(t *testing.T) {
+	cases := []string{
+		"",
+		"bogus",
+		"70r/20r",
+		"99999999999999999999r",
+	}
+
+	for _, spec := range cases {
+		if _, err := ParseWorkloadSpec(spec); err == nil {
+			t.Errorf("ParseWorkloadSpec(%q): expected error, got nil", spec)
+		}
+	}
+}
+
+func TestWorkloadSpecValidateRejectsOverflow(t *testing.T) {
+	ws := &WorkloadSpec{PutRatio: math.MaxUint64 - 1, GetRatio: 1}
+
+	if err := ws.validate(); err == nil {
+		t.Fatalf("expected validate() to reject a ratio sum overflowing int64, got nil")
+	}
+}
+
+func TestWorkloadSpecValidateRejectsZero(t *testing.T) {
+	ws := &WorkloadSpec{}
+
+	if err := ws.validate(); err == nil {
+		t.Errorf("expected validate() to reject an all-zero mix, got nil")
+	}
+}
+
+func TestNextOpDoesNotPanicOnValidatedLargeRatios(t *testing.T) {
+	// A regression check for the overflow bug: a ratio that validate() accepts must never
+	// make NextOp panic inside Int63n.
+	ws := &WorkloadSpec{PutRatio: math.MaxInt64 - 1, GetRatio: 1}
+
+	if err := ws.validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	rng := rand.New(rand.NewSource(0))
+	for i := 0; i < 100; i++ {
+		ws.NextOp(rng)
+	}
+}
+
+func TestNextOpDistribution(t *testing.T) {
+	ws := &WorkloadSpec{PutRatio: 1, GetRatio: 0, DeleteRatio: 0}
+	rng := rand.New(rand.NewSource(0))
+
+	for i := 0; i < 100; i++ {
+		if op := ws.NextOp(rng); op != OpPut {
+			t.Fatalf("expected OpPut with PutRatio-only mix, got %v", op)
+		}
+	}
+}